@@ -0,0 +1,75 @@
+package server
+
+import (
+	"io"
+	"sync"
+)
+
+// WriteBroadcaster fans out everything written to it to any number of
+// registered io.WriteClosers, mirroring the broadcaster used by docker's
+// container.go to let multiple clients attach to the same running job.
+type WriteBroadcaster struct {
+	mu      sync.Mutex
+	writers map[io.WriteCloser]struct{}
+	closed  bool
+}
+
+func NewWriteBroadcaster() *WriteBroadcaster {
+	return &WriteBroadcaster{
+		writers: make(map[io.WriteCloser]struct{}),
+	}
+}
+
+// AddWriter registers w to receive everything written from now on.
+func (b *WriteBroadcaster) AddWriter(w io.WriteCloser) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		w.Close()
+		return
+	}
+
+	b.writers[w] = struct{}{}
+}
+
+// RemoveWriter detaches w without closing it.
+func (b *WriteBroadcaster) RemoveWriter(w io.WriteCloser) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.writers, w)
+}
+
+func (b *WriteBroadcaster) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for w := range b.writers {
+		if _, err := w.Write(p); err != nil {
+			delete(b.writers, w)
+		}
+	}
+
+	return len(p), nil
+}
+
+// Close closes and detaches every registered writer. Writers added after
+// Close are closed immediately instead of being registered.
+func (b *WriteBroadcaster) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil
+	}
+
+	b.closed = true
+
+	for w := range b.writers {
+		w.Close()
+		delete(b.writers, w)
+	}
+
+	return nil
+}
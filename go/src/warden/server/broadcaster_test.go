@@ -0,0 +1,71 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+)
+
+type closableBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *closableBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestWriteBroadcasterFansOutToEveryWriter(t *testing.T) {
+	b := NewWriteBroadcaster()
+
+	w1 := &closableBuffer{}
+	w2 := &closableBuffer{}
+
+	b.AddWriter(w1)
+	b.AddWriter(w2)
+
+	b.Write([]byte("hello"))
+
+	if w1.String() != "hello" || w2.String() != "hello" {
+		t.Fatalf("expected both writers to receive \"hello\", got %q and %q", w1.String(), w2.String())
+	}
+}
+
+func TestWriteBroadcasterRemoveWriterStopsDelivery(t *testing.T) {
+	b := NewWriteBroadcaster()
+
+	w := &closableBuffer{}
+	b.AddWriter(w)
+	b.RemoveWriter(w)
+
+	b.Write([]byte("hello"))
+
+	if w.String() != "" {
+		t.Fatalf("expected removed writer to receive nothing, got %q", w.String())
+	}
+}
+
+func TestWriteBroadcasterCloseClosesEveryWriter(t *testing.T) {
+	b := NewWriteBroadcaster()
+
+	w := &closableBuffer{}
+	b.AddWriter(w)
+
+	b.Close()
+
+	if !w.closed {
+		t.Fatal("expected Close to close registered writers")
+	}
+}
+
+func TestWriteBroadcasterAddWriterAfterCloseClosesImmediately(t *testing.T) {
+	b := NewWriteBroadcaster()
+	b.Close()
+
+	w := &closableBuffer{}
+	b.AddWriter(w)
+
+	if !w.closed {
+		t.Fatal("expected AddWriter after Close to close the writer immediately")
+	}
+}
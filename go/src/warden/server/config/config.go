@@ -0,0 +1,25 @@
+// Package config holds wardend's server-wide configuration: the paths
+// it shells out to for container scripts, and the pools it allocates
+// containers' network/port/uid resources from.
+package config
+
+import "warden/server/pool"
+
+// ServerConfig holds the filesystem layout wardend uses to create and
+// run containers.
+type ServerConfig struct {
+	ContainerDepotPath  string
+	ContainerScriptPath string
+	ContainerRootfsPath string
+	ContainerGraceTime  int
+}
+
+// Config is the top-level configuration passed to NewContainer and
+// LinuxContainerPool.
+type Config struct {
+	Server ServerConfig
+
+	NetworkPool *pool.NetworkPool
+	PortPool    *pool.PortPool
+	UserPool    *pool.UserPool
+}
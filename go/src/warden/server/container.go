@@ -6,13 +6,18 @@ import (
 	"errors"
 	"fmt"
 	steno "github.com/cloudfoundry/gosteno"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 	"warden/protocol"
 	"warden/server/config"
+	"warden/server/limits"
 	"warden/server/pool"
 )
 
@@ -31,9 +36,6 @@ const (
 	StateDestroyed = State("destroyed")
 )
 
-type Job struct {
-}
-
 type LinuxContainer struct {
 	c *config.Config
 	r chan chan *Request
@@ -49,6 +51,27 @@ type LinuxContainer struct {
 
 	IdleTimeout time.Duration
 
+	jobsMu    sync.Mutex
+	Jobs      map[uint32]*Job
+	nextJobId uint32
+
+	cgroups *limits.CgroupsManager
+	quota   *limits.QuotaManager
+	oom     *limits.OOMWatcher
+
+	// oomCh signals Run's serialized request loop that the OOM watcher
+	// has fired, so the resulting stop is handled on the same goroutine
+	// as every other state transition instead of racing it from the
+	// watcher's own goroutine.
+	oomCh chan struct{}
+
+	MemoryLimit    *int64
+	CpuShares      *int64
+	DiskLimit      *int64
+	BandwidthLimit *int64
+
+	events *EventBroadcaster
+
 	steno.Logger
 }
 
@@ -70,6 +93,7 @@ func NewContainer(s *Server, cfg *config.Config) *LinuxContainer {
 	c.c = cfg
 	c.r = make(chan chan *Request)
 	c.s = s
+	c.oomCh = make(chan struct{}, 1)
 
 	c.State = StateBorn
 	c.Id = NextId()
@@ -81,6 +105,16 @@ func NewContainer(s *Server, cfg *config.Config) *LinuxContainer {
 	// Initialize idle timeout
 	c.IdleTimeout = time.Duration(c.c.Server.ContainerGraceTime) * time.Second
 
+	// Initialize job table
+	c.Jobs = make(map[uint32]*Job)
+
+	// Initialize resource managers
+	c.cgroups = limits.NewCgroupsManager(limits.DefaultCgroupRoot, c.Id)
+	c.quota = limits.NewQuotaManager(c.c.Server.ContainerRootfsPath)
+
+	// Initialize event stream
+	c.events = NewEventBroadcaster()
+
 	// Setup container-specific logger
 	l := steno.NewLogger("container")
 	c.Logger = steno.NewTaggedLogger(l, map[string]string{"id": c.Id})
@@ -90,10 +124,15 @@ func NewContainer(s *Server, cfg *config.Config) *LinuxContainer {
 
 // Acquires pooled resources.
 // If a resource is already bound to the container, remove it from its pool.
-// This behavior is required for resuming from a snapshot.
+// This behavior is required for resuming from a snapshot. If any removal
+// fails partway through, the resources already reserved in this call are
+// rolled back so a failed restore cannot leak them.
 func (c *LinuxContainer) Acquire() error {
 	if c.Network != nil {
-		c.c.NetworkPool.Remove(*c.Network)
+		err := c.c.NetworkPool.Remove(*c.Network)
+		if err != nil {
+			return err
+		}
 	} else {
 		p, ok := c.c.NetworkPool.Acquire()
 		if !ok {
@@ -104,16 +143,25 @@ func (c *LinuxContainer) Acquire() error {
 	}
 
 	if c.Ports != nil {
-		for _, p := range c.Ports {
-			c.c.PortPool.Remove(*p)
+		for i, p := range c.Ports {
+			err := c.c.PortPool.Remove(*p)
+			if err != nil {
+				c.rollbackAcquire(true, c.Ports[:i])
+				return err
+			}
 		}
 	}
 
 	if c.UserId != nil {
-		c.c.UserPool.Remove(*c.UserId)
+		err := c.c.UserPool.Remove(*c.UserId)
+		if err != nil {
+			c.rollbackAcquire(true, c.Ports)
+			return err
+		}
 	} else {
 		p, ok := c.c.UserPool.Acquire()
 		if !ok {
+			c.rollbackAcquire(true, c.Ports)
 			return errors.New("LinuxContainer: Cannot acquire user ID")
 		}
 
@@ -123,6 +171,18 @@ func (c *LinuxContainer) Acquire() error {
 	return nil
 }
 
+// rollbackAcquire releases resources reserved earlier in Acquire() once a
+// later reservation in the same call fails.
+func (c *LinuxContainer) rollbackAcquire(network bool, ports []*pool.Port) {
+	if network && c.Network != nil {
+		c.c.NetworkPool.Release(*c.Network)
+	}
+
+	for _, p := range ports {
+		c.c.PortPool.Release(*p)
+	}
+}
+
 // Releases pooled resources.
 func (c *LinuxContainer) Release() error {
 	if c.Network != nil {
@@ -146,6 +206,143 @@ func (c *LinuxContainer) Release() error {
 	return nil
 }
 
+// Snapshot is the subset of LinuxContainer state that is persisted to
+// disk and used to resume a container across a server restart.
+type Snapshot struct {
+	Id     string
+	Handle string
+	State  State
+
+	Network *pool.IP
+	Ports   []*pool.Port
+	UserId  *pool.UserId
+
+	IdleTimeout time.Duration
+
+	JobIds    []uint32
+	NextJobId uint32
+
+	MemoryLimit    *int64
+	CpuShares      *int64
+	DiskLimit      *int64
+	BandwidthLimit *int64
+}
+
+// Snapshot captures the container's restorable state.
+func (c *LinuxContainer) Snapshot() *Snapshot {
+	jobIds := c.jobIds()
+
+	return &Snapshot{
+		Id:     c.Id,
+		Handle: c.Handle,
+		State:  c.State,
+
+		Network: c.Network,
+		Ports:   c.Ports,
+		UserId:  c.UserId,
+
+		IdleTimeout: c.IdleTimeout,
+
+		JobIds:    jobIds,
+		NextJobId: atomic.LoadUint32(&c.nextJobId),
+
+		MemoryLimit:    c.MemoryLimit,
+		CpuShares:      c.CpuShares,
+		DiskLimit:      c.DiskLimit,
+		BandwidthLimit: c.BandwidthLimit,
+	}
+}
+
+// RestoreFromSnapshot applies a previously captured Snapshot and
+// re-acquires the container's pooled resources, so that the container
+// resumes in the state it was in before the server restarted. Jobs
+// recorded in the snapshot are not resumed; see below.
+func (c *LinuxContainer) RestoreFromSnapshot(s *Snapshot) error {
+	c.Id = s.Id
+	c.Handle = s.Handle
+	c.State = s.State
+
+	// c.cgroups was built in NewContainer against the throwaway Id
+	// generated for this process's lifetime, not the restored one - rebuild
+	// it against s.Id or limit reapplication below targets a cgroup
+	// directory that doesn't exist.
+	c.cgroups = limits.NewCgroupsManager(limits.DefaultCgroupRoot, c.Id)
+
+	c.Network = s.Network
+	c.Ports = s.Ports
+	c.UserId = s.UserId
+
+	c.IdleTimeout = s.IdleTimeout
+
+	// Jobs that were in flight when wardend restarted cannot be
+	// reconnected to their real child process (its PID isn't persisted,
+	// and nothing reattaches to its spawn.sh/wsh session). Rather than
+	// leave DoLink/DoAttach blocked on them forever, resolve them
+	// immediately with a sentinel "lost" exit status.
+	for _, id := range s.JobIds {
+		job := NewJob(id, nil)
+		job.finish(jobStatusLost)
+		c.putJob(job)
+	}
+
+	atomic.StoreUint32(&c.nextJobId, s.NextJobId)
+
+	c.MemoryLimit = s.MemoryLimit
+	c.CpuShares = s.CpuShares
+	c.DiskLimit = s.DiskLimit
+	c.BandwidthLimit = s.BandwidthLimit
+
+	// Add handle to logger, as DoCreate does
+	c.Logger = steno.NewTaggedLogger(c.Logger, map[string]string{"handle": c.Handle})
+
+	err := c.Acquire()
+	if err != nil {
+		return err
+	}
+
+	return c.reapplyLimits()
+}
+
+// reapplyLimits re-applies every resource limit that was in effect
+// before a restore, since the underlying cgroups and quotas do not
+// survive a container's process table entry being recreated.
+func (c *LinuxContainer) reapplyLimits() error {
+	if c.MemoryLimit != nil {
+		err := c.cgroups.SetInt64("memory", "memory.limit_in_bytes", *c.MemoryLimit)
+		if err != nil {
+			return err
+		}
+
+		err = c.watchOOM()
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.CpuShares != nil {
+		err := c.cgroups.SetInt64("cpu", "cpu.shares", *c.CpuShares)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.DiskLimit != nil {
+		err := c.quota.SetBlockLimit(int(*c.UserId), *c.DiskLimit, *c.DiskLimit)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.BandwidthLimit != nil {
+		err := c.cgroups.SetInt64("blkio", "blkio.throttle.write_bps_device", *c.BandwidthLimit)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (c *LinuxContainer) snapshotPath() string {
 	return path.Join(c.ContainerPath(), "etc", "snapshot.json")
 }
@@ -178,7 +375,7 @@ func (c *LinuxContainer) markClean() error {
 	z := bufio.NewWriter(y)
 
 	e := json.NewEncoder(z)
-	err = e.Encode(c)
+	err = e.Encode(c.Snapshot())
 	if err != nil {
 		c.Warnf("Unable to encode snapshot: %s", err)
 		return err
@@ -228,7 +425,13 @@ func (c *LinuxContainer) Run() {
 	for stop := false; !stop; {
 		select {
 		case <-i.C:
+			c.publishEvent(Event{Type: EventIdleWarning})
 			stop = true
+		case <-c.oomCh:
+			c.runOOMStop()
+
+			// Overwrite idle timeout
+			i.D <- c.IdleTimeout
 		case c.r <- x:
 			i.Ref()
 
@@ -253,24 +456,59 @@ func (c *LinuxContainer) Run() {
 	}
 }
 
+// runOOMStop handles an OOM notification on Run's own goroutine, so the
+// resulting state transition is serialized against every other request
+// instead of being applied directly from the OOM watcher's goroutine.
+func (c *LinuxContainer) runOOMStop() {
+	before := c.State
+
+	c.Warnf("Container hit its memory limit, stopping")
+
+	c.markDirty()
+	c.doStop(true, false)
+	c.markClean()
+
+	if c.State != before {
+		c.publishEvent(Event{Type: EventStateChanged, State: c.State})
+	}
+}
+
 func (c *LinuxContainer) runRequest(r *Request) {
 	t1 := time.Now()
 
-	switch c.State {
-	case StateBorn:
-		c.runBorn(r)
-
-	case StateActive:
-		c.runActive(r)
+	before := c.State
 
-	case StateStopped:
-		c.runStopped(r)
+	switch req := r.r.(type) {
+	case *protocol.InfoRequest:
+		c.DoInfo(r, req)
 
-	case StateDestroyed:
-		c.runDestroyed(r)
+	case *protocol.EventStreamRequest:
+		// DoEventStream runs until the client disconnects, which can be
+		// indefinitely; it must not occupy the container's single
+		// serialized request slot for its whole lifetime.
+		go c.DoEventStream(r, req)
 
 	default:
-		panic("Unknown state: " + c.State)
+		switch c.State {
+		case StateBorn:
+			c.runBorn(r)
+
+		case StateActive:
+			c.runActive(r)
+
+		case StateStopped:
+			c.runStopped(r)
+
+		case StateDestroyed:
+			c.runDestroyed(r)
+
+		default:
+			panic("Unknown state: " + c.State)
+		}
+	}
+
+	if c.State != before {
+		c.publishEvent(Event{Type: EventStateChanged, State: c.State})
 	}
 
 	t2 := time.Now()
@@ -278,6 +516,13 @@ func (c *LinuxContainer) runRequest(r *Request) {
 	c.Debugf("took: %.6fs", t2.Sub(t1).Seconds())
 }
 
+// publishEvent stamps e with the current time and publishes it to every
+// client currently attached via an EventStreamRequest.
+func (c *LinuxContainer) publishEvent(e Event) {
+	e.Timestamp = time.Now()
+	c.events.Publish(e)
+}
+
 func (c *LinuxContainer) writeInvalidState(r *Request) {
 	r.WriteErrorResponse(fmt.Sprintf("Cannot execute request in state: %s", c.State))
 }
@@ -305,6 +550,59 @@ func (c *LinuxContainer) runActive(r *Request) {
 		c.markDirty()
 		c.DoDestroy(r, req)
 
+	// Run/Attach/Link can each block for the lifetime of a job, which
+	// may outlive any single request by a wide margin. They run off the
+	// container's serialized request queue so a long (or indefinitely
+	// attached) job cannot wedge Stop/Destroy/Info and everything else
+	// behind it.
+	case *protocol.RunRequest:
+		go c.DoRun(r, req)
+
+	case *protocol.SpawnRequest:
+		c.markDirty()
+		c.DoSpawn(r, req)
+		c.markClean()
+
+	case *protocol.AttachRequest:
+		go c.DoAttach(r, req)
+
+	case *protocol.LinkRequest:
+		go c.DoLink(r, req)
+
+	case *protocol.LimitMemoryRequest:
+		c.markDirty()
+		c.DoLimitMemory(r, req)
+		c.markClean()
+
+	case *protocol.LimitCpuRequest:
+		c.markDirty()
+		c.DoLimitCpu(r, req)
+		c.markClean()
+
+	case *protocol.LimitDiskRequest:
+		c.markDirty()
+		c.DoLimitDisk(r, req)
+		c.markClean()
+
+	case *protocol.LimitBandwidthRequest:
+		c.markDirty()
+		c.DoLimitBandwidth(r, req)
+		c.markClean()
+
+	case *protocol.NetInRequest:
+		c.markDirty()
+		c.DoNetIn(r, req)
+		c.markClean()
+
+	case *protocol.NetOutRequest:
+		c.DoNetOut(r, req)
+
+	case *protocol.CopyInRequest:
+		c.DoCopyIn(r, req)
+
+	case *protocol.CopyOutRequest:
+		c.DoCopyOut(r, req)
+
 	default:
 		c.writeInvalidState(r)
 	}
@@ -437,6 +735,10 @@ func (c *LinuxContainer) doDestroy() error {
 	c.State = StateDestroyed
 	c.s.R.Unregister(c)
 
+	if c.oom != nil {
+		c.oom.Stop()
+	}
+
 	// Remove directory
 	err = os.RemoveAll(c.ContainerPath())
 	if err != nil {
@@ -458,3 +760,538 @@ func (c *LinuxContainer) DoDestroy(x *Request, req *protocol.DestroyRequest) {
 	res := &protocol.DestroyResponse{}
 	x.WriteResponse(res)
 }
+
+// getJob looks up a job by id. It is safe to call concurrently with
+// putJob/jobIds, which Run/Attach/Link now require since they execute
+// off the container's serialized request queue.
+func (c *LinuxContainer) getJob(id uint32) (*Job, bool) {
+	c.jobsMu.Lock()
+	defer c.jobsMu.Unlock()
+
+	j, ok := c.Jobs[id]
+	return j, ok
+}
+
+func (c *LinuxContainer) putJob(j *Job) {
+	c.jobsMu.Lock()
+	defer c.jobsMu.Unlock()
+
+	c.Jobs[j.Id] = j
+}
+
+func (c *LinuxContainer) jobIds() []uint32 {
+	c.jobsMu.Lock()
+	defer c.jobsMu.Unlock()
+
+	ids := make([]uint32, 0, len(c.Jobs))
+	for id := range c.Jobs {
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+// doSpawn execs spawn.sh inside the container's namespaces (via wsh) and
+// starts copying its combined stdout/stderr into the job's broadcaster.
+// The job is tracked on the container so it can be attached to or
+// linked against after this call returns, and survives detach.
+func (c *LinuxContainer) doSpawn(script string) (*Job, error) {
+	id := atomic.AddUint32(&c.nextJobId, 1)
+
+	cmd := exec.Command(path.Join(c.c.Server.ContainerScriptPath, "spawn.sh"), c.ContainerPath(), script)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	job := NewJob(id, cmd)
+
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	// cmd.Wait() must not run until both copies have drained the pipes
+	// it closes, or the job's output can be truncated and finish() can
+	// race the trailing bytes.
+	var copied sync.WaitGroup
+	copied.Add(2)
+
+	go func() {
+		defer copied.Done()
+		io.Copy(job.out, stdout)
+	}()
+
+	go func() {
+		defer copied.Done()
+		io.Copy(job.out, stderr)
+	}()
+
+	c.putJob(job)
+
+	go func() {
+		copied.Wait()
+		status := exitStatusOf(cmd.Wait())
+		job.finish(status)
+		c.publishEvent(Event{Type: EventJobExited, JobId: id, ExitStatus: status})
+	}()
+
+	return job, nil
+}
+
+// streamJob writes a StreamResponse frame for everything job produces,
+// as read from spawn.sh's stdout/stderr through the job's broadcaster
+// (link.sh is not used), followed by one final frame
+// carrying its exit status once it is known. Multiple requests may
+// stream the same job concurrently.
+func (c *LinuxContainer) streamJob(x *Request, job *Job) {
+	w := newResponseWriter(x)
+
+	job.out.AddWriter(w)
+	defer job.out.RemoveWriter(w)
+
+	status := job.Wait()
+
+	res := &protocol.StreamResponse{}
+	res.ExitStatus = &status
+	x.WriteResponse(res)
+}
+
+// DoRun spawns a command and blocks, streaming its output and final
+// exit status back on the same request.
+func (c *LinuxContainer) DoRun(x *Request, req *protocol.RunRequest) {
+	job, err := c.doSpawn(req.GetScript())
+	if err != nil {
+		x.WriteErrorResponse(err.Error())
+		return
+	}
+
+	c.streamJob(x, job)
+}
+
+// DoSpawn starts a command in the background and immediately returns its
+// JobId, so the caller can attach or link to it later.
+func (c *LinuxContainer) DoSpawn(x *Request, req *protocol.SpawnRequest) {
+	job, err := c.doSpawn(req.GetScript())
+	if err != nil {
+		x.WriteErrorResponse(err.Error())
+		return
+	}
+
+	res := &protocol.SpawnResponse{}
+	res.JobId = &job.Id
+	x.WriteResponse(res)
+}
+
+// DoAttach streams the output of an already-running job, picked up from
+// wherever it currently is, to the requesting client.
+func (c *LinuxContainer) DoAttach(x *Request, req *protocol.AttachRequest) {
+	job, ok := c.getJob(req.GetJobId())
+	if !ok {
+		x.WriteErrorResponse(fmt.Sprintf("LinuxContainer: unknown job id: %d", req.GetJobId()))
+		return
+	}
+
+	c.streamJob(x, job)
+}
+
+// DoLink blocks until the given job has exited and returns its exit
+// status, without streaming its output. It may be called any number of
+// times, including after the job has already exited, which is how
+// spawned jobs get reaped.
+func (c *LinuxContainer) DoLink(x *Request, req *protocol.LinkRequest) {
+	job, ok := c.getJob(req.GetJobId())
+	if !ok {
+		x.WriteErrorResponse(fmt.Sprintf("LinuxContainer: unknown job id: %d", req.GetJobId()))
+		return
+	}
+
+	status := job.Wait()
+
+	res := &protocol.LinkResponse{}
+	res.ExitStatus = &status
+	x.WriteResponse(res)
+}
+
+// watchOOM arms the container's OOM watcher, if it isn't armed already,
+// stopping the container the moment the kernel reports it has hit its
+// memory limit.
+func (c *LinuxContainer) watchOOM() error {
+	if c.oom != nil {
+		return nil
+	}
+
+	c.oom = limits.NewOOMWatcher(c.cgroups)
+
+	// The watcher invokes this on its own goroutine, which must not touch
+	// c.State directly - that's owned by Run's serialized request loop.
+	// Publish the event here (Publish is safe to call from any goroutine)
+	// and hand the actual stop off to runOOMStop via oomCh.
+	return c.oom.Watch(func() {
+		c.publishEvent(Event{Type: EventOOM})
+
+		select {
+		case c.oomCh <- struct{}{}:
+		default:
+			// A stop is already queued or in flight.
+		}
+	})
+}
+
+// DoLimitMemory sets the container's memory.limit_in_bytes, or just
+// reports the effective limit if no new value is given, and arms the
+// OOM watcher so the container is stopped if the kernel kills it.
+func (c *LinuxContainer) DoLimitMemory(x *Request, req *protocol.LimitMemoryRequest) {
+	if limit := req.GetLimitInBytes(); limit != 0 {
+		err := c.cgroups.SetInt64("memory", "memory.limit_in_bytes", limit)
+		if err != nil {
+			x.WriteErrorResponse(err.Error())
+			return
+		}
+	}
+
+	effective, err := c.cgroups.GetInt64("memory", "memory.limit_in_bytes")
+	if err != nil {
+		x.WriteErrorResponse(err.Error())
+		return
+	}
+
+	c.MemoryLimit = &effective
+
+	err = c.watchOOM()
+	if err != nil {
+		x.WriteErrorResponse(err.Error())
+		return
+	}
+
+	res := &protocol.LimitMemoryResponse{}
+	res.LimitInBytes = &effective
+	x.WriteResponse(res)
+}
+
+// DoLimitCpu sets the container's cpu.shares, or just reports the
+// effective value if no new value is given.
+func (c *LinuxContainer) DoLimitCpu(x *Request, req *protocol.LimitCpuRequest) {
+	if shares := req.GetLimitInShares(); shares != 0 {
+		err := c.cgroups.SetInt64("cpu", "cpu.shares", shares)
+		if err != nil {
+			x.WriteErrorResponse(err.Error())
+			return
+		}
+	}
+
+	effective, err := c.cgroups.GetInt64("cpu", "cpu.shares")
+	if err != nil {
+		x.WriteErrorResponse(err.Error())
+		return
+	}
+
+	c.CpuShares = &effective
+
+	res := &protocol.LimitCpuResponse{}
+	res.LimitInShares = &effective
+	x.WriteResponse(res)
+}
+
+// DoLimitDisk sets the disk quota for the container's UserId via
+// QuotaManager, then reports its current usage.
+func (c *LinuxContainer) DoLimitDisk(x *Request, req *protocol.LimitDiskRequest) {
+	if limit := req.GetByteLimit(); limit != 0 {
+		err := c.quota.SetBlockLimit(int(*c.UserId), limit, limit)
+		if err != nil {
+			x.WriteErrorResponse(err.Error())
+			return
+		}
+
+		c.DiskLimit = &limit
+	}
+
+	usage, err := c.quota.BlockUsage(int(*c.UserId))
+	if err != nil {
+		x.WriteErrorResponse(err.Error())
+		return
+	}
+
+	res := &protocol.LimitDiskResponse{}
+	res.ByteUsage = &usage
+	x.WriteResponse(res)
+}
+
+// DoLimitBandwidth writes the given rate to the blkio cgroup's
+// blkio.throttle.write_bps_device, or just reports the last rate set on
+// this container if no new value is given. Network traffic is not
+// throttled.
+func (c *LinuxContainer) DoLimitBandwidth(x *Request, req *protocol.LimitBandwidthRequest) {
+	if rate := req.GetRate(); rate != 0 {
+		err := c.cgroups.SetInt64("blkio", "blkio.throttle.write_bps_device", rate)
+		if err != nil {
+			x.WriteErrorResponse(err.Error())
+			return
+		}
+
+		c.BandwidthLimit = &rate
+	}
+
+	res := &protocol.LimitBandwidthResponse{}
+	res.Rate = c.BandwidthLimit
+	x.WriteResponse(res)
+}
+
+// DoNetIn allocates a host port and installs a DNAT rule forwarding it
+// to a port inside the container. The allocated host port is added to
+// c.Ports so it is released, and reserved again on restore, along with
+// the container's other resources.
+func (c *LinuxContainer) DoNetIn(x *Request, req *protocol.NetInRequest) {
+	hostPort, ok := c.c.PortPool.Acquire()
+	if !ok {
+		x.WriteErrorResponse("LinuxContainer: cannot acquire port")
+		return
+	}
+
+	containerPort := req.GetContainerPort()
+	if containerPort == 0 {
+		containerPort = uint32(hostPort)
+	}
+
+	cmd := exec.Command(path.Join(c.c.Server.ContainerScriptPath, "net.sh"), "--in", c.ContainerPath())
+	cmd.Env = append(cmd.Env, fmt.Sprintf("HOST_PORT=%d", uint32(hostPort)))
+	cmd.Env = append(cmd.Env, fmt.Sprintf("CONTAINER_PORT=%d", containerPort))
+
+	err := runCommand(cmd)
+	if err != nil {
+		c.c.PortPool.Release(hostPort)
+		x.WriteErrorResponse(err.Error())
+		return
+	}
+
+	c.Ports = append(c.Ports, &hostPort)
+
+	res := &protocol.NetInResponse{}
+	hp := uint32(hostPort)
+	res.HostPort = &hp
+	res.ContainerPort = &containerPort
+	x.WriteResponse(res)
+}
+
+// DoNetOut punches an egress hole in the container's OUT chain, allowing
+// outbound traffic matching the given network/port filter.
+func (c *LinuxContainer) DoNetOut(x *Request, req *protocol.NetOutRequest) {
+	cmd := exec.Command(path.Join(c.c.Server.ContainerScriptPath, "net.sh"), "--out", c.ContainerPath())
+	cmd.Env = append(cmd.Env, fmt.Sprintf("NETWORK=%s", req.GetNetwork()))
+	cmd.Env = append(cmd.Env, fmt.Sprintf("PORT=%d", req.GetPort()))
+
+	err := runCommand(cmd)
+	if err != nil {
+		x.WriteErrorResponse(err.Error())
+		return
+	}
+
+	res := &protocol.NetOutResponse{}
+	x.WriteResponse(res)
+}
+
+// wshRemoteShell builds the rsync -e argument that tunnels rsync's data
+// stream through the container's wsh helper instead of ssh.
+func (c *LinuxContainer) wshRemoteShell() string {
+	return fmt.Sprintf("%s --socket %s",
+		path.Join(c.ContainerPath(), "bin", "wsh"),
+		path.Join(c.ContainerPath(), "run", "wshd.sock"),
+	)
+}
+
+// remotePath dresses up path as an rsync remote so wshRemoteShell is
+// invoked instead of rsync trying to read/write it locally. The host
+// part is a placeholder: the remote shell always connects to this
+// container, regardless of what it is.
+func (c *LinuxContainer) remotePath(path string) string {
+	return fmt.Sprintf("vcap@container:%s", path)
+}
+
+// copy shells out to rsync to transfer src to dst, translating
+// ownership to the container's UserId. Trailing slashes on src/dst are
+// passed through untouched, so rsync's own directory-vs-contents
+// semantics apply.
+func (c *LinuxContainer) copy(src string, dst string) error {
+	if src == "" || dst == "" {
+		return errors.New("LinuxContainer: copy requires both a source and a destination path")
+	}
+
+	cmd := exec.Command("rsync",
+		"-r", "-p",
+		"-e", c.wshRemoteShell(),
+		"--chown", fmt.Sprintf("%d:%d", int(*c.UserId), int(*c.UserId)),
+		src, dst,
+	)
+
+	return runCommand(cmd)
+}
+
+// DoCopyIn copies a file or directory from the host into the container.
+func (c *LinuxContainer) DoCopyIn(x *Request, req *protocol.CopyInRequest) {
+	if c.State != StateActive {
+		c.writeInvalidState(x)
+		return
+	}
+
+	src := req.GetSrcPath()
+	dst := req.GetDstPath()
+
+	if src == "" || dst == "" {
+		x.WriteErrorResponse("LinuxContainer: copy requires both a source and a destination path")
+		return
+	}
+
+	err := c.copy(src, c.remotePath(dst))
+	if err != nil {
+		x.WriteErrorResponse(err.Error())
+		return
+	}
+
+	res := &protocol.CopyInResponse{}
+	x.WriteResponse(res)
+}
+
+// DoCopyOut copies a file or directory out of the container onto the
+// host.
+func (c *LinuxContainer) DoCopyOut(x *Request, req *protocol.CopyOutRequest) {
+	if c.State != StateActive {
+		c.writeInvalidState(x)
+		return
+	}
+
+	src := req.GetSrcPath()
+	dst := req.GetDstPath()
+
+	if src == "" || dst == "" {
+		x.WriteErrorResponse("LinuxContainer: copy requires both a source and a destination path")
+		return
+	}
+
+	err := c.copy(c.remotePath(src), dst)
+	if err != nil {
+		x.WriteErrorResponse(err.Error())
+		return
+	}
+
+	res := &protocol.CopyOutResponse{}
+	x.WriteResponse(res)
+}
+
+func exitStatusOf(err error) uint32 {
+	if err == nil {
+		return 0
+	}
+
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			return uint32(status.ExitStatus())
+		}
+	}
+
+	return 1
+}
+
+// DoInfo returns a snapshot of the container's current state, network
+// configuration, allocated ports, resource usage and the ids of every
+// job it tracks, whether still running or already exited.
+// Unlike most other requests, it is valid in every container state.
+func (c *LinuxContainer) DoInfo(x *Request, req *protocol.InfoRequest) {
+	res := &protocol.InfoResponse{}
+
+	state := string(c.State)
+	res.State = &state
+	res.Handle = &c.Handle
+
+	if c.Network != nil {
+		hostIp := c.Network.Add(1).String()
+		containerIp := c.Network.Add(2).String()
+		res.HostIp = &hostIp
+		res.ContainerIp = &containerIp
+	}
+
+	for _, p := range c.Ports {
+		res.Ports = append(res.Ports, uint32(*p))
+	}
+
+	res.JobIds = append(res.JobIds, c.jobIds()...)
+
+	if c.MemoryLimit != nil {
+		usage, err := c.cgroups.GetInt64("memory", "memory.usage_in_bytes")
+		if err != nil {
+			c.Warnf("Unable to read memory usage: %s", err)
+		} else {
+			res.MemoryStat = &protocol.MemoryStat{}
+			res.MemoryStat.UsageInBytes = &usage
+			res.MemoryStat.LimitInBytes = c.MemoryLimit
+		}
+	}
+
+	if c.CpuShares != nil {
+		usage, err := c.cgroups.GetInt64("cpu", "cpuacct.usage")
+		if err != nil {
+			c.Warnf("Unable to read cpu usage: %s", err)
+		} else {
+			res.CpuStat = &protocol.CpuStat{}
+			res.CpuStat.UsageInNanoseconds = &usage
+			res.CpuStat.Shares = c.CpuShares
+		}
+	}
+
+	if c.DiskLimit != nil && c.UserId != nil {
+		usage, err := c.quota.BlockUsage(int(*c.UserId))
+		if err != nil {
+			c.Warnf("Unable to read disk usage: %s", err)
+		} else {
+			res.DiskStat = &protocol.DiskStat{}
+			res.DiskStat.ByteUsage = &usage
+			res.DiskStat.ByteLimit = c.DiskLimit
+		}
+	}
+
+	x.WriteResponse(res)
+}
+
+// DoEventStream keeps the request open and pushes a typed EventResponse
+// frame for every container event (state transitions, OOM, job exit,
+// idle-timeout warning) until the client disconnects.
+func (c *LinuxContainer) DoEventStream(x *Request, req *protocol.EventStreamRequest) {
+	ch := c.events.Subscribe()
+	defer c.events.Unsubscribe(ch)
+
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+
+			res := &protocol.EventResponse{}
+
+			t := string(e.Type)
+			res.Type = &t
+
+			if e.State != "" {
+				s := string(e.State)
+				res.State = &s
+			}
+
+			if e.Type == EventJobExited {
+				res.JobId = &e.JobId
+				res.ExitStatus = &e.ExitStatus
+			}
+
+			x.WriteResponse(res)
+
+		case <-x.done:
+			// Client disconnected (or the request was otherwise torn
+			// down); stop streaming instead of blocking forever.
+			return
+		}
+	}
+}
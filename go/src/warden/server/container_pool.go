@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+
+	steno "github.com/cloudfoundry/gosteno"
+
+	"warden/server/config"
+)
+
+// LinuxContainerPool is the registry of containers known to the server
+// (this is the type backing Server.R). Besides tracking live containers
+// for lookup by handle, it is responsible for restoring containers from
+// their on-disk snapshots when wardend starts up.
+type LinuxContainerPool struct {
+	c *config.Config
+	s *Server
+
+	containers map[string]Container
+
+	steno.Logger
+}
+
+func NewLinuxContainerPool(s *Server, cfg *config.Config) *LinuxContainerPool {
+	p := &LinuxContainerPool{}
+
+	p.c = cfg
+	p.s = s
+	p.containers = make(map[string]Container)
+	p.Logger = steno.NewLogger("container_pool")
+
+	return p
+}
+
+func (p *LinuxContainerPool) Register(c Container) {
+	p.containers[c.GetHandle()] = c
+}
+
+func (p *LinuxContainerPool) Unregister(c Container) {
+	delete(p.containers, c.GetHandle())
+}
+
+func (p *LinuxContainerPool) Find(handle string) (Container, bool) {
+	c, ok := p.containers[handle]
+	return c, ok
+}
+
+// Restore walks the container depot and resumes every container whose
+// snapshot can be decoded and whose pooled resources can be re-acquired.
+// Entries that fail to restore are logged and skipped rather than
+// aborting the whole pass, so a single corrupt snapshot cannot block
+// startup of the rest of the containers.
+func (p *LinuxContainerPool) Restore() error {
+	entries, err := ioutil.ReadDir(p.c.Server.ContainerDepotPath)
+	if err != nil {
+		p.Warnf("Unable to read container depot: %s", err)
+		return err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		err := p.restoreOne(entry.Name())
+		if err != nil {
+			p.Warnf("Unable to restore container %s: %s", entry.Name(), err)
+			continue
+		}
+	}
+
+	return nil
+}
+
+func (p *LinuxContainerPool) restoreOne(handle string) error {
+	f, err := os.Open(path.Join(p.c.Server.ContainerDepotPath, handle, "etc", "snapshot.json"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	s := &Snapshot{}
+
+	err = json.NewDecoder(f).Decode(s)
+	if err != nil {
+		return err
+	}
+
+	c := NewContainer(p.s, p.c)
+
+	err = c.RestoreFromSnapshot(s)
+	if err != nil {
+		return err
+	}
+
+	p.Register(c)
+
+	go c.Run()
+
+	p.Infof("Restored container %s", c.Handle)
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"warden/server/config"
+	"warden/server/limits"
+	"warden/server/pool"
+)
+
+func testConfig(depot string) *config.Config {
+	cfg := &config.Config{}
+
+	cfg.Server.ContainerDepotPath = depot
+	cfg.NetworkPool = pool.NewNetworkPool(pool.IP(0xC0A80000), 1)
+	cfg.PortPool = pool.NewPortPool(pool.Port(60000), 1)
+	cfg.UserPool = pool.NewUserPool(pool.UserId(10000), 1)
+
+	return cfg
+}
+
+func TestAcquireReservesResourcesForNewContainer(t *testing.T) {
+	c := &LinuxContainer{c: testConfig(""), Ports: make([]*pool.Port, 0)}
+
+	err := c.Acquire()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if c.Network == nil || c.UserId == nil {
+		t.Fatal("expected a network and user id to be reserved")
+	}
+
+	if _, ok := c.c.NetworkPool.Acquire(); ok {
+		t.Fatal("expected the pool's only network to already be reserved")
+	}
+}
+
+func TestAcquireReacquiresBoundResourcesOnRestore(t *testing.T) {
+	cfg := testConfig("")
+
+	network := pool.IP(0xC0A80000)
+	uid := pool.UserId(10000)
+
+	c := &LinuxContainer{c: cfg, Network: &network, UserId: &uid, Ports: make([]*pool.Port, 0)}
+
+	err := c.Acquire()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, ok := cfg.NetworkPool.Acquire(); ok {
+		t.Fatal("expected the restored network to already be removed from the pool")
+	}
+}
+
+func TestAcquireRollsBackReservedResourcesOnFailure(t *testing.T) {
+	cfg := testConfig("")
+
+	// uid is not in the pool's free list, so reserving it fails.
+	uid := pool.UserId(99999)
+
+	c := &LinuxContainer{c: cfg, UserId: &uid, Ports: make([]*pool.Port, 0)}
+
+	err := c.Acquire()
+	if err == nil {
+		t.Fatal("expected an error reserving an unavailable user id")
+	}
+
+	if _, ok := cfg.NetworkPool.Acquire(); !ok {
+		t.Fatal("expected the network reserved earlier in Acquire to be rolled back")
+	}
+}
+
+func TestLinuxContainerPoolRestoreOneDoesNotRegisterOnAcquireFailure(t *testing.T) {
+	depot, err := ioutil.TempDir("", "depot")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(depot)
+
+	cfg := testConfig(depot)
+
+	network := pool.IP(0x0A000000) // not in cfg.NetworkPool's range
+	writeSnapshot(t, depot, "handle-a", &Snapshot{Id: "handle-a", Handle: "handle-a", Network: &network})
+
+	p := NewLinuxContainerPool(nil, cfg)
+
+	err = p.restoreOne("handle-a")
+	if err == nil {
+		t.Fatal("expected restoreOne to fail when a resource cannot be reacquired")
+	}
+
+	if _, ok := p.Find("handle-a"); ok {
+		t.Fatal("expected a container that failed to restore to not be registered")
+	}
+}
+
+func TestLinuxContainerPoolRestoreOneReappliesLimits(t *testing.T) {
+	depot, err := ioutil.TempDir("", "depot")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(depot)
+
+	cfg := testConfig(depot)
+
+	cpuShares := int64(512)
+	s := &Snapshot{Id: "handle-b", Handle: "handle-b", CpuShares: &cpuShares}
+	writeSnapshot(t, depot, "handle-b", s)
+
+	cgroupPath := path.Join(limits.DefaultCgroupRoot, "cpu", "instance-handle-b")
+	if err := os.MkdirAll(cgroupPath, 0755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(path.Join(limits.DefaultCgroupRoot, "cpu", "instance-handle-b"))
+
+	p := NewLinuxContainerPool(nil, cfg)
+
+	err = p.restoreOne("handle-b")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got, err := limits.NewCgroupsManager(limits.DefaultCgroupRoot, "handle-b").GetInt64("cpu", "cpu.shares")
+	if err != nil {
+		t.Fatalf("unexpected error reading back cpu.shares: %s", err)
+	}
+
+	if got != cpuShares {
+		t.Fatalf("expected cpu.shares to be reapplied as %d, got %d", cpuShares, got)
+	}
+}
+
+func writeSnapshot(t *testing.T, depot string, handle string, s *Snapshot) {
+	t.Helper()
+
+	etc := path.Join(depot, handle, "etc")
+	if err := os.MkdirAll(etc, 0755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	f, err := os.Create(path.Join(etc, "snapshot.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer f.Close()
+
+	if err := json.NewEncoder(f).Encode(s); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
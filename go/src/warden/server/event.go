@@ -0,0 +1,74 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType identifies the kind of structured event published on a
+// container's event stream.
+type EventType string
+
+const (
+	EventStateChanged = EventType("state_changed")
+	EventOOM          = EventType("oom")
+	EventJobExited    = EventType("job_exited")
+	EventIdleWarning  = EventType("idle_warning")
+)
+
+// Event is a single structured record published on a container's event
+// stream, consumed by EventStreamRequest.
+type Event struct {
+	Type      EventType
+	Timestamp time.Time
+
+	State      State
+	JobId      uint32
+	ExitStatus uint32
+}
+
+// EventBroadcaster fans out a container's events to any number of
+// subscribed EventStreamRequest handlers.
+type EventBroadcaster struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+func NewEventBroadcaster() *EventBroadcaster {
+	return &EventBroadcaster{
+		subs: make(map[chan Event]struct{}),
+	}
+}
+
+// Subscribe returns a channel that receives every event published from
+// now on. The channel is buffered; a slow subscriber drops events rather
+// than blocking the publisher.
+func (b *EventBroadcaster) Subscribe() chan Event {
+	ch := make(chan Event, 16)
+
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch
+}
+
+func (b *EventBroadcaster) Unsubscribe(ch chan Event) {
+	b.mu.Lock()
+	delete(b.subs, ch)
+	b.mu.Unlock()
+
+	close(ch)
+}
+
+func (b *EventBroadcaster) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package server
+
+import "testing"
+
+func TestEventBroadcasterDeliversToEverySubscriber(t *testing.T) {
+	b := NewEventBroadcaster()
+
+	ch1 := b.Subscribe()
+	ch2 := b.Subscribe()
+
+	b.Publish(Event{Type: EventOOM})
+
+	for _, ch := range []chan Event{ch1, ch2} {
+		select {
+		case e := <-ch:
+			if e.Type != EventOOM {
+				t.Fatalf("expected %s, got %s", EventOOM, e.Type)
+			}
+		default:
+			t.Fatal("expected event to be delivered without blocking")
+		}
+	}
+}
+
+func TestEventBroadcasterUnsubscribeClosesChannel(t *testing.T) {
+	b := NewEventBroadcaster()
+
+	ch := b.Subscribe()
+	b.Unsubscribe(ch)
+
+	_, ok := <-ch
+	if ok {
+		t.Fatal("expected channel to be closed after Unsubscribe")
+	}
+}
+
+func TestEventBroadcasterUnsubscribedSubscriberDoesNotReceive(t *testing.T) {
+	b := NewEventBroadcaster()
+
+	ch := b.Subscribe()
+	b.Unsubscribe(ch)
+
+	b.Publish(Event{Type: EventOOM})
+
+	if e, ok := <-ch; ok {
+		t.Fatalf("expected no event after Unsubscribe, got %s", e.Type)
+	}
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"os/exec"
+)
+
+// jobStatusLost is the exit status given to a job restored from a
+// snapshot: wardend has no way to reconnect it to its real child
+// process, so its true outcome can never be known.
+const jobStatusLost = 255
+
+// Job is an in-flight (or already-exited) invocation of spawn.sh inside
+// a container. Its combined stdout/stderr are fanned out to every
+// client currently attached via DoAttach/DoRun, and its exit status is
+// latched once known so DoLink can be called any number of times, by
+// any number of clients, both before and after the job actually exits.
+type Job struct {
+	Id uint32
+
+	cmd *exec.Cmd
+	out *WriteBroadcaster
+
+	done       chan struct{}
+	exitStatus uint32
+}
+
+func NewJob(id uint32, cmd *exec.Cmd) *Job {
+	return &Job{
+		Id:   id,
+		cmd:  cmd,
+		out:  NewWriteBroadcaster(),
+		done: make(chan struct{}),
+	}
+}
+
+// Wait blocks until the job has exited and returns its exit status. It
+// is safe to call from multiple goroutines.
+func (j *Job) Wait() uint32 {
+	<-j.done
+	return j.exitStatus
+}
+
+// finish latches the job's exit status, wakes up any goroutine blocked
+// in Wait, and closes its broadcaster so attached clients see EOF.
+func (j *Job) finish(status uint32) {
+	j.exitStatus = status
+	close(j.done)
+	j.out.Close()
+}
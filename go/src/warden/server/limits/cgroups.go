@@ -0,0 +1,58 @@
+package limits
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// DefaultCgroupRoot is where wardend mounts the cgroup subsystems it
+// manages on behalf of containers.
+const DefaultCgroupRoot = "/tmp/warden/cgroup"
+
+// CgroupsManager writes and reads the control files of a single
+// container's cgroup, rooted at <root>/<subsystem>/instance-<id>.
+type CgroupsManager struct {
+	root string
+	id   string
+}
+
+func NewCgroupsManager(root string, id string) *CgroupsManager {
+	return &CgroupsManager{root: root, id: id}
+}
+
+func (m *CgroupsManager) subsystemPath(subsystem string) string {
+	return path.Join(m.root, subsystem, fmt.Sprintf("instance-%s", m.id))
+}
+
+// Set writes value to the named control file within subsystem.
+func (m *CgroupsManager) Set(subsystem string, file string, value string) error {
+	return ioutil.WriteFile(path.Join(m.subsystemPath(subsystem), file), []byte(value), 0644)
+}
+
+// Get reads back the effective value of the named control file.
+func (m *CgroupsManager) Get(subsystem string, file string) (string, error) {
+	b, err := ioutil.ReadFile(path.Join(m.subsystemPath(subsystem), file))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(b)), nil
+}
+
+// SetInt64 is Set for the common case of an integer-valued control file.
+func (m *CgroupsManager) SetInt64(subsystem string, file string, value int64) error {
+	return m.Set(subsystem, file, strconv.FormatInt(value, 10))
+}
+
+// GetInt64 is Get for the common case of an integer-valued control file.
+func (m *CgroupsManager) GetInt64(subsystem string, file string) (int64, error) {
+	s, err := m.Get(subsystem, file)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(s, 10, 64)
+}
@@ -0,0 +1,52 @@
+package limits
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestCgroupsManagerSetGet(t *testing.T) {
+	root, err := ioutil.TempDir("", "cgroups")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(root)
+
+	err = os.MkdirAll(path.Join(root, "memory", "instance-abc"), 0755)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	m := NewCgroupsManager(root, "abc")
+
+	err = m.SetInt64("memory", "memory.limit_in_bytes", 1048576)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got, err := m.GetInt64("memory", "memory.limit_in_bytes")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got != 1048576 {
+		t.Fatalf("expected 1048576, got %d", got)
+	}
+}
+
+func TestCgroupsManagerGetMissingFile(t *testing.T) {
+	root, err := ioutil.TempDir("", "cgroups")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(root)
+
+	m := NewCgroupsManager(root, "abc")
+
+	_, err = m.Get("memory", "memory.limit_in_bytes")
+	if err == nil {
+		t.Fatal("expected an error reading a nonexistent control file")
+	}
+}
@@ -0,0 +1,59 @@
+package limits
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// eventFd wraps a Linux eventfd, used to receive cgroup notifications
+// such as memory.oom_control events.
+type eventFd struct {
+	f *os.File
+}
+
+func newEventFd() (*eventFd, error) {
+	// Non-blocking, so the runtime poller owns reads and Close can
+	// interrupt a goroutine blocked in Wait.
+	fd, _, errno := syscall.Syscall(syscall.SYS_EVENTFD2, 0, syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+
+	return &eventFd{f: os.NewFile(fd, "eventfd")}, nil
+}
+
+func (e *eventFd) Fd() uintptr {
+	return e.f.Fd()
+}
+
+// Wait blocks until the kernel signals the eventfd and returns the
+// counter value it was signalled with.
+func (e *eventFd) Wait() (uint64, error) {
+	buf := make([]byte, 8)
+
+	_, err := e.f.Read(buf)
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.LittleEndian.Uint64(buf), nil
+}
+
+func (e *eventFd) Close() error {
+	return e.f.Close()
+}
+
+// writeEventControl registers efd to be signalled via cfd, using the
+// cgroup generic notification API (cgroup.event_control).
+func writeEventControl(path string, efd uintptr, cfd uintptr) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "%d %d", efd, cfd)
+	return err
+}
@@ -0,0 +1,81 @@
+package limits
+
+import (
+	"os"
+	"path"
+	"sync"
+)
+
+// OOMWatcher watches a cgroup's memory.oom_control for OOM events via
+// cgroups' generic eventfd notification mechanism, and invokes a
+// callback whenever the kernel reports one.
+type OOMWatcher struct {
+	manager *CgroupsManager
+
+	mu  sync.Mutex
+	efd *eventFd
+}
+
+func NewOOMWatcher(manager *CgroupsManager) *OOMWatcher {
+	return &OOMWatcher{manager: manager}
+}
+
+// Watch registers an eventfd against memory.oom_control and invokes
+// onOOM each time the kernel reports that the cgroup has hit an OOM
+// condition, until Stop is called.
+func (w *OOMWatcher) Watch(onOOM func()) error {
+	efd, err := newEventFd()
+	if err != nil {
+		return err
+	}
+
+	oomControlPath := path.Join(w.manager.subsystemPath("memory"), "memory.oom_control")
+	eventControlPath := path.Join(w.manager.subsystemPath("memory"), "cgroup.event_control")
+
+	oomControl, err := os.Open(oomControlPath)
+	if err != nil {
+		efd.Close()
+		return err
+	}
+
+	err = writeEventControl(eventControlPath, efd.Fd(), oomControl.Fd())
+	if err != nil {
+		oomControl.Close()
+		efd.Close()
+		return err
+	}
+
+	w.mu.Lock()
+	w.efd = efd
+	w.mu.Unlock()
+
+	go func() {
+		defer oomControl.Close()
+
+		for {
+			_, err := efd.Wait()
+			if err != nil {
+				// Closed by Stop(), or the cgroup is gone.
+				return
+			}
+
+			onOOM()
+		}
+	}()
+
+	return nil
+}
+
+// Stop closes the watcher's eventfd, which unblocks its goroutine's
+// read on efd.Wait() and lets it exit even if no further OOM event ever
+// arrives. It is safe to call Stop even if Watch was never called, or
+// more than once.
+func (w *OOMWatcher) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.efd != nil {
+		w.efd.Close()
+		w.efd = nil
+	}
+}
@@ -0,0 +1,76 @@
+package limits
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// QuotaManager enforces and reports disk usage limits for a container's
+// UserId via the filesystem's quota tools (setquota/repquota).
+type QuotaManager struct {
+	device string
+}
+
+func NewQuotaManager(device string) *QuotaManager {
+	return &QuotaManager{device: device}
+}
+
+// SetBlockLimit sets the soft and hard block limits (in bytes) for uid
+// on the manager's device.
+func (m *QuotaManager) SetBlockLimit(uid int, softBytes int64, hardBytes int64) error {
+	cmd := exec.Command("setquota",
+		"-u", strconv.Itoa(uid),
+		strconv.FormatInt(softBytes/1024, 10),
+		strconv.FormatInt(hardBytes/1024, 10),
+		"0", "0",
+		m.device,
+	)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("setquota: %s: %s", err, string(out))
+	}
+
+	return nil
+}
+
+// BlockUsage reports the current block usage (in bytes) for uid, parsed
+// out of repquota's csv output.
+func (m *QuotaManager) BlockUsage(uid int) (int64, error) {
+	cmd := exec.Command("repquota", "-u", "-O", "csv", m.device)
+
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("repquota: %s", err)
+	}
+
+	return parseRepquotaBlockUsage(string(out), uid)
+}
+
+// parseRepquotaBlockUsage pulls the block-usage column (in 1K blocks)
+// for uid out of `repquota -u -O csv` output and converts it to bytes.
+func parseRepquotaBlockUsage(output string, uid int) (int64, error) {
+	prefix := fmt.Sprintf("%d,", uid)
+
+	for _, line := range strings.Split(output, "\n") {
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+
+		fields := strings.Split(line, ",")
+		if len(fields) < 2 {
+			continue
+		}
+
+		blocks, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+
+		return blocks * 1024, nil
+	}
+
+	return 0, fmt.Errorf("repquota: no entry for uid %d", uid)
+}
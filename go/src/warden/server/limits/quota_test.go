@@ -0,0 +1,26 @@
+package limits
+
+import "testing"
+
+func TestParseRepquotaBlockUsage(t *testing.T) {
+	output := "1000,100,200,0,5,10,20,0\n" +
+		"1001,500,1000,0,12,50,100,0\n"
+
+	usage, err := parseRepquotaBlockUsage(output, 1001)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if usage != 500*1024 {
+		t.Fatalf("expected %d bytes, got %d", 500*1024, usage)
+	}
+}
+
+func TestParseRepquotaBlockUsageNoEntry(t *testing.T) {
+	output := "1000,100,200,0,5,10,20,0\n"
+
+	_, err := parseRepquotaBlockUsage(output, 1001)
+	if err == nil {
+		t.Fatal("expected an error for a uid with no entry")
+	}
+}
@@ -0,0 +1,84 @@
+// Package pool hands out and reclaims the host-side resources a
+// container needs for its lifetime: a /30 network, host ports, and a
+// uid. Each pool is a free list guarded by a mutex; Acquire/Release pairs
+// are used for ordinary allocation, and Remove/Release pairs are used to
+// pull a specific, already-known resource out of (or back into) the pool
+// when a container is resumed from a snapshot.
+package pool
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// IP is the first address of a container's /30 network.
+type IP uint32
+
+// Add returns the address n past ip, without mutating ip.
+func (ip IP) Add(n uint32) IP {
+	return ip + IP(n)
+}
+
+func (ip IP) String() string {
+	return fmt.Sprintf("%d.%d.%d.%d", byte(ip>>24), byte(ip>>16), byte(ip>>8), byte(ip))
+}
+
+// NetworkPool hands out non-overlapping /30 networks, each identified by
+// its first address, carved out of a contiguous range.
+type NetworkPool struct {
+	mu   sync.Mutex
+	free []IP
+}
+
+// NewNetworkPool carves size /30 networks out of the range starting at
+// start.
+func NewNetworkPool(start IP, size uint32) *NetworkPool {
+	p := &NetworkPool{}
+
+	for i := uint32(0); i < size; i++ {
+		p.free = append(p.free, start.Add(i*4))
+	}
+
+	return p
+}
+
+// Acquire reserves and returns the next available network.
+func (p *NetworkPool) Acquire() (IP, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.free) == 0 {
+		return 0, false
+	}
+
+	ip := p.free[0]
+	p.free = p.free[1:]
+
+	return ip, true
+}
+
+// Release returns ip to the pool of available networks.
+func (p *NetworkPool) Release(ip IP) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.free = append(p.free, ip)
+}
+
+// Remove takes ip out of the pool of available networks, so that it is
+// reserved without having come through Acquire. It returns an error if
+// ip is not currently available.
+func (p *NetworkPool) Remove(ip IP) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, f := range p.free {
+		if f == ip {
+			p.free = append(p.free[:i], p.free[i+1:]...)
+			return nil
+		}
+	}
+
+	return errors.New("pool: network not available: " + ip.String())
+}
@@ -0,0 +1,68 @@
+package pool
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Port is a host port handed out by a PortPool, e.g. for DoNetIn.
+type Port uint32
+
+// PortPool hands out host ports, one at a time, out of a contiguous
+// range.
+type PortPool struct {
+	mu   sync.Mutex
+	free []Port
+}
+
+// NewPortPool makes size ports available, starting at start.
+func NewPortPool(start Port, size uint32) *PortPool {
+	p := &PortPool{}
+
+	for i := uint32(0); i < size; i++ {
+		p.free = append(p.free, start+Port(i))
+	}
+
+	return p
+}
+
+// Acquire reserves and returns the next available port.
+func (p *PortPool) Acquire() (Port, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.free) == 0 {
+		return 0, false
+	}
+
+	port := p.free[0]
+	p.free = p.free[1:]
+
+	return port, true
+}
+
+// Release returns port to the pool of available ports.
+func (p *PortPool) Release(port Port) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.free = append(p.free, port)
+}
+
+// Remove takes port out of the pool of available ports, so that it is
+// reserved without having come through Acquire. It returns an error if
+// port is not currently available.
+func (p *PortPool) Remove(port Port) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, f := range p.free {
+		if f == port {
+			p.free = append(p.free[:i], p.free[i+1:]...)
+			return nil
+		}
+	}
+
+	return errors.New("pool: port not available: " + fmt.Sprintf("%d", port))
+}
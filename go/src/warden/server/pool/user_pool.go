@@ -0,0 +1,67 @@
+package pool
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// UserId is a container-local uid handed out by a UserPool.
+type UserId uint32
+
+// UserPool hands out uids, one at a time, out of a contiguous range.
+type UserPool struct {
+	mu   sync.Mutex
+	free []UserId
+}
+
+// NewUserPool makes size uids available, starting at start.
+func NewUserPool(start UserId, size uint32) *UserPool {
+	p := &UserPool{}
+
+	for i := uint32(0); i < size; i++ {
+		p.free = append(p.free, start+UserId(i))
+	}
+
+	return p
+}
+
+// Acquire reserves and returns the next available uid.
+func (p *UserPool) Acquire() (UserId, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.free) == 0 {
+		return 0, false
+	}
+
+	uid := p.free[0]
+	p.free = p.free[1:]
+
+	return uid, true
+}
+
+// Release returns uid to the pool of available uids.
+func (p *UserPool) Release(uid UserId) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.free = append(p.free, uid)
+}
+
+// Remove takes uid out of the pool of available uids, so that it is
+// reserved without having come through Acquire. It returns an error if
+// uid is not currently available.
+func (p *UserPool) Remove(uid UserId) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, f := range p.free {
+		if f == uid {
+			p.free = append(p.free[:i], p.free[i+1:]...)
+			return nil
+		}
+	}
+
+	return errors.New("pool: user id not available: " + fmt.Sprintf("%d", uid))
+}
@@ -0,0 +1,30 @@
+package server
+
+import (
+	"warden/protocol"
+)
+
+// responseWriter adapts a Request to io.WriteCloser by wrapping each
+// Write in a StreamResponse frame, so a Job's WriteBroadcaster can write
+// directly to it.
+type responseWriter struct {
+	x *Request
+}
+
+func newResponseWriter(x *Request) *responseWriter {
+	return &responseWriter{x: x}
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	data := string(p)
+
+	res := &protocol.StreamResponse{}
+	res.Data = &data
+	w.x.WriteResponse(res)
+
+	return len(p), nil
+}
+
+func (w *responseWriter) Close() error {
+	return nil
+}